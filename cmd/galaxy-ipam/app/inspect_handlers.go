@@ -0,0 +1,90 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+)
+
+// registerInspectHandlers wires the read-only /v1/pool/{subnet} and /v1/ip/{ip} status
+// endpoints onto mux. Both support ?format=json (default) and ?format=table.
+func registerInspectHandlers(mux *http.ServeMux, inspector floatingip.Inspector) {
+	mux.HandleFunc("/v1/pool/", func(w http.ResponseWriter, r *http.Request) {
+		subnet := strings.TrimPrefix(r.URL.Path, "/v1/pool/")
+		if subnet == "" {
+			http.NotFound(w, r)
+			return
+		}
+		status, err := inspector.InspectPool(subnet)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeInspectResult(w, r, status, renderPoolTable)
+	})
+	mux.HandleFunc("/v1/ip/", func(w http.ResponseWriter, r *http.Request) {
+		ipStr := strings.TrimPrefix(r.URL.Path, "/v1/ip/")
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			http.Error(w, fmt.Sprintf("invalid ip %q", ipStr), http.StatusBadRequest)
+			return
+		}
+		status, err := inspector.InspectIP(ip)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeInspectResult(w, r, status, renderIPTable)
+	})
+}
+
+func writeInspectResult(w http.ResponseWriter, r *http.Request, v interface{}, renderTable func(w http.ResponseWriter, v interface{})) {
+	switch r.URL.Query().Get("format") {
+	case "table":
+		renderTable(w, v)
+	default:
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			glog.Errorf("failed to encode inspect result: %v", err)
+		}
+	}
+}
+
+func renderPoolTable(w http.ResponseWriter, v interface{}) {
+	status := v.(*floatingip.PoolStatus)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANGE\tGATEWAY\tVLAN\tTOTAL\tALLOCATED\tRESERVED\tFREE")
+	for _, rs := range status.Ranges {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\n", rs.Range, rs.Gateway, rs.Vlan, rs.Total, rs.Allocated, rs.Reserved, rs.Free)
+	}
+	tw.Flush()
+}
+
+func renderIPTable(w http.ResponseWriter, v interface{}) {
+	status := v.(*floatingip.IPStatus)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "IP\tROUTABLE SUBNET\tRANGE ID\tBOUND\tKEY\tPOLICY")
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%d\n", status.IP, status.RoutableSubnet, status.RangeID, status.Bound, status.Key, status.Policy)
+	tw.Flush()
+}
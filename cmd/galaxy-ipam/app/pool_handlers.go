@@ -0,0 +1,103 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+)
+
+// registerPoolHandlers wires the runtime FloatingIPPool CRUD endpoints onto mux, so pools can
+// be created, updated, listed and deleted without restarting galaxy-ipam.
+func registerPoolHandlers(mux *http.ServeMux, pools floatingip.PoolManager) {
+	mux.HandleFunc("/v1/pool", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			listPools(w, pools)
+		case http.MethodPost:
+			createPool(w, r, pools)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/v1/pool/", func(w http.ResponseWriter, r *http.Request) {
+		subnet := strings.TrimPrefix(r.URL.Path, "/v1/pool/")
+		if subnet == "" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			updatePool(w, r, pools, subnet)
+		case http.MethodDelete:
+			deletePool(w, r, pools, subnet)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func listPools(w http.ResponseWriter, pools floatingip.PoolManager) {
+	if err := json.NewEncoder(w).Encode(pools.ListPools()); err != nil {
+		glog.Errorf("failed to encode pool list: %v", err)
+	}
+}
+
+func createPool(w http.ResponseWriter, r *http.Request, pools floatingip.PoolManager) {
+	var req floatingip.PoolCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pool, err := pools.CreatePool(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(pool); err != nil {
+		glog.Errorf("failed to encode created pool: %v", err)
+	}
+}
+
+func updatePool(w http.ResponseWriter, r *http.Request, pools floatingip.PoolManager, subnet string) {
+	var conf floatingip.FloatingIPPoolConf
+	if err := json.NewDecoder(r.Body).Decode(&conf); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if conf.RoutableSubnet == nil || conf.RoutableSubnet.String() != subnet {
+		http.Error(w, "routableSubnet in body must match the URL", http.StatusBadRequest)
+		return
+	}
+	if err := pools.UpdatePool(&conf); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+func deletePool(w http.ResponseWriter, r *http.Request, pools floatingip.PoolManager, subnet string) {
+	force := r.URL.Query().Get("force") == "true"
+	if err := pools.DeletePool(subnet, force); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+}
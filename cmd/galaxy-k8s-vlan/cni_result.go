@@ -0,0 +1,127 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/ns"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/vishvananda/netlink"
+)
+
+// result100Versions are the cniVersions this plugin answers with a types100.Result rather than
+// the legacy 0.2.0 shaped one.
+var result100Versions = map[string]bool{
+	"0.3.0": true,
+	"0.3.1": true,
+	"0.4.0": true,
+	"1.0.0": true,
+}
+
+// buildResult100 assembles a types100.Result describing the veth pair ADD created on the host
+// and inside the container, plus the bridge or dummy device they attach to. Interfaces[] lists
+// the host veth, the bridge/dummy master and the container veth in that order, and IPs[].Interface
+// points at the container veth's index so 1.0.0 consumers can tell which interface an address
+// belongs to without guessing.
+func buildResult100(cniVersion, hostVethName, masterName, containerVethName, netnsPath string, containerIP net.IPNet, gateway net.IP, routes []*net.IPNet) *current.Result {
+	result := &current.Result{CNIVersion: cniVersion}
+	result.Interfaces = []*current.Interface{
+		{Name: hostVethName},
+		{Name: masterName},
+		{Name: containerVethName, Sandbox: netnsPath},
+	}
+	containerIfaceIdx := len(result.Interfaces) - 1
+	result.IPs = []*current.IPConfig{
+		{
+			Address:   containerIP,
+			Gateway:   gateway,
+			Interface: current.Int(containerIfaceIdx),
+		},
+	}
+	for _, r := range routes {
+		result.Routes = append(result.Routes, &types.Route{Dst: *r, GW: gateway})
+	}
+	return result
+}
+
+// checkResult100 re-derives the topology inside netnsPath and checks it against result, the
+// way cmdCheck is required to for cniVersion >= 0.4.0: the container veth must still carry
+// every recorded address and route, and the host-side peer named in Interfaces[] must still
+// exist. Addresses and routes beyond the recorded ones are not rejected.
+func checkResult100(netnsPath string, result *current.Result) error {
+	if len(result.Interfaces) == 0 || len(result.IPs) == 0 {
+		return fmt.Errorf("nothing to check, empty CNI result")
+	}
+	hostIface := result.Interfaces[0]
+	if _, err := netlink.LinkByName(hostIface.Name); err != nil {
+		return fmt.Errorf("host interface %s missing: %v", hostIface.Name, err)
+	}
+	containerIface := result.Interfaces[len(result.Interfaces)-1]
+	return ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(containerIface.Name)
+		if err != nil {
+			return fmt.Errorf("container interface %s missing inside netns: %v", containerIface.Name, err)
+		}
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return err
+		}
+		for _, ipc := range result.IPs {
+			found := false
+			for _, addr := range addrs {
+				if addr.IPNet.String() == ipc.Address.String() {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("expected address %s not found on %s", ipc.Address.String(), containerIface.Name)
+			}
+		}
+		routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return err
+		}
+		for _, r := range result.Routes {
+			ones, _ := r.Dst.Mask.Size()
+			found := false
+			for _, route := range routes {
+				// netlink leaves Dst nil for a default route rather than filling in the
+				// zero network, so an expected default route must match that nil too.
+				if route.Dst == nil {
+					found = ones == 0
+				} else {
+					found = route.Dst.String() == r.Dst.String()
+				}
+				if found {
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("expected route %s not found on %s", r.Dst.String(), containerIface.Name)
+			}
+		}
+		return nil
+	})
+}
+
+func isCNI100Version(cniVersion string) bool {
+	return result100Versions[cniVersion]
+}
@@ -17,13 +17,56 @@
 package k8s_vlan
 
 import (
+	"encoding/json"
+	"fmt"
+
+	current "github.com/containernetworking/cni/pkg/types/100"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	"tkestack.io/galaxy/e2e/helper"
 	"tkestack.io/galaxy/pkg/utils"
 	"tkestack.io/galaxy/pkg/utils/ips"
 )
 
+// cniVersions are the schema versions this plugin must negotiate: 0.2.0 keeps the legacy result
+// shape, 0.3.x/0.4.0/1.0.0 get a types100.Result with Interfaces[]/IPs[].Interface filled in.
+var cniVersions = []string{"0.2.0", "0.3.0", "0.3.1", "0.4.0", "1.0.0"}
+
+// cniVersionEntries builds one ginkgo table Entry per supported cniVersion.
+func cniVersionEntries() []TableEntry {
+	entries := make([]TableEntry, 0, len(cniVersions))
+	for _, v := range cniVersions {
+		entries = append(entries, Entry(fmt.Sprintf("cniVersion %s", v), v))
+	}
+	return entries
+}
+
+// assertCNIResult checks that resultJSON negotiated the requested cniVersion, and, for the
+// 0.3.0+ family that carries a types100.Result, that the 1.0.0 interface-index invariants hold:
+// Interfaces[] has three entries with the container veth (the one with a Sandbox) last, and
+// every IPs[] entry's Interface points at that container veth.
+func assertCNIResult(resultJSON []byte, cniVersion string) {
+	var versioned struct {
+		CNIVersion string `json:"cniVersion"`
+	}
+	Expect(json.Unmarshal(resultJSON, &versioned)).To(Succeed())
+	Expect(versioned.CNIVersion).To(Equal(cniVersion))
+	if cniVersion == "0.2.0" {
+		return
+	}
+	var result current.Result
+	Expect(json.Unmarshal(resultJSON, &result)).To(Succeed())
+	Expect(result.Interfaces).To(HaveLen(3))
+	containerIfaceIdx := len(result.Interfaces) - 1
+	Expect(result.Interfaces[containerIfaceIdx].Sandbox).NotTo(BeEmpty())
+	Expect(result.IPs).NotTo(BeEmpty())
+	for _, ipc := range result.IPs {
+		Expect(ipc.Interface).NotTo(BeNil())
+		Expect(*ipc.Interface).To(Equal(containerIfaceIdx))
+	}
+}
+
 var _ = Describe("galaxy-k8s-vlan bridge and pure test", func() {
 	cni := "galaxy-k8s-vlan"
 	ifaceCidr := "192.168.0.66/26"
@@ -32,12 +75,15 @@ var _ = Describe("galaxy-k8s-vlan bridge and pure test", func() {
 	cidrIPNet, _ := ips.ParseCIDR(ifaceCidr)
 	argsStr, _ := helper.IPInfo(containerCidr, 0)
 
-	var cmdAdd = func(netConf []byte) string {
-		nsPath := helper.CmdAdd(containerId, ifaceCidr, argsStr, cni,
-			`{"cniVersion":"0.2.0","ip4":{"ip":"192.168.0.68/26","gateway":"192.168.0.65","routes":[{"dst":"0.0.0.0/0"}]},"dns":{}}`, netConf)
+	var cmdAdd = func(cniVersion string, netConf []byte) (string, []byte) {
+		ip4Conf := fmt.Sprintf(
+			`{"cniVersion":%q,"ip4":{"ip":"192.168.0.68/26","gateway":"192.168.0.65","routes":[{"dst":"0.0.0.0/0"}]},"dns":{}}`,
+			cniVersion)
+		nsPath, resultJSON := helper.CmdAdd(containerId, ifaceCidr, argsStr, cni, ip4Conf, netConf)
 		_, err := helper.Ping("192.168.0.68")
 		Expect(err).NotTo(HaveOccurred())
-		return nsPath
+		assertCNIResult(resultJSON, cniVersion)
+		return nsPath, resultJSON
 	}
 
 	AfterEach(func() {
@@ -45,14 +91,15 @@ var _ = Describe("galaxy-k8s-vlan bridge and pure test", func() {
 		helper.CleanupDummy()
 		helper.CleanupIFace("brtest")
 	})
-	It("bridge", func() {
+
+	DescribeTable("bridge", func(cniVersion string) {
 		netConf := []byte(`{
     "name": "myvlan",
     "type": "galaxy-k8s-vlan",
     "device": "dummy0",
     "default_bridge_name": "brtest"
 }`)
-		nsPath := cmdAdd(netConf)
+		nsPath, _ := cmdAdd(cniVersion, netConf)
 		// check host iface topology, route, neigh, ip address is expected
 		//TODO verify why ifaceCidr is still on dummy0
 		//err := (&helper.NetworkTopology{
@@ -72,16 +119,18 @@ var _ = Describe("galaxy-k8s-vlan bridge and pure test", func() {
 
 		// test DEL command
 		helper.CmdDel(containerId, cni, netConf)
-	})
+	},
+		cniVersionEntries()...,
+	)
 
-	It("pure switch", func() {
+	DescribeTable("pure switch", func(cniVersion string) {
 		netConf := []byte(`{
     "name": "myvlan",
     "type": "galaxy-k8s-vlan",
     "device": "dummy0",
     "switch": "pure"
 }`)
-		nsPath := cmdAdd(netConf)
+		nsPath, _ := cmdAdd(cniVersion, netConf)
 		// check host iface topology, route, neigh, ip address is expected
 		err := (&helper.NetworkTopology{
 			LeaveDevices: []*helper.LinkDevice{
@@ -93,5 +142,7 @@ var _ = Describe("galaxy-k8s-vlan bridge and pure test", func() {
 
 		// check container iface topology, route, neigh, ip address is expected
 		helper.CheckContainerTopology(nsPath, containerCidr, "192.168.0.65")
-	})
+	},
+		cniVersionEntries()...,
+	)
 })
@@ -0,0 +1,73 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"fmt"
+	"time"
+
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// AllocateIP finds the first unbound, unreserved address in the pool identified by
+// routableSubnet, walking its ranges and each range's addresses in order so allocation is
+// deterministic, and persists it bound to key with the RangeID of the range it came from, so
+// updateFloatingIP can find the right range again after a controller restart.
+func (ci *crdIpam) AllocateIP(routableSubnet, key string) (*FloatingIP, error) {
+	ci.RLock()
+	i := ci.indexOfPool(routableSubnet)
+	if i == -1 {
+		ci.RUnlock()
+		return nil, fmt.Errorf("pool %s not found", routableSubnet)
+	}
+	pool := ci.FloatingIPs[i]
+	ci.RUnlock()
+
+	fips, err := ci.listFloatingIPs()
+	if err != nil {
+		return nil, err
+	}
+	bound := make(map[string]bool, len(fips.Items))
+	for j := range fips.Items {
+		if fips.Items[j].Spec.Key != "" {
+			bound[fips.Items[j].Name] = true
+		}
+	}
+
+	pool.RLock()
+	defer pool.RUnlock()
+	for _, ipr := range pool.IPRanges {
+		first, last := nets.IPToInt(ipr.First), nets.IPToInt(ipr.Last)
+		for cur := first; cur <= last; cur++ {
+			ip := nets.IntToIP(cur)
+			if bound[ip.String()] {
+				continue
+			}
+			rangeID, ok := pool.AllocatableRangeID(ip)
+			if !ok {
+				// outside the pool or reserved by its range
+				continue
+			}
+			allocated := &FloatingIP{Key: key, IP: ip, RangeID: rangeID, UpdatedAt: time.Now()}
+			if err := ci.createFloatingIP(allocated); err != nil {
+				return nil, err
+			}
+			return allocated, nil
+		}
+	}
+	return nil, fmt.Errorf("no free floating ip left in pool %s", routableSubnet)
+}
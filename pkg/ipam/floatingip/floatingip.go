@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -34,22 +35,107 @@ type FloatingIP struct {
 	IP        net.IP
 	Policy    uint16
 	UpdatedAt time.Time
+	// RangeID identifies which IPRange of the FloatingIPPool this ip was allocated from, so
+	// updateFloatingIP can find the right range again after a controller restart.
+	RangeID string
+	// MAC is the mac address the CNI plugin assigned this ip, if any, so the same mac can be
+	// requested again when the container re-attaches after a galaxy-ipam restart.
+	MAC string
+}
+
+// Attribute is the structured form persisted in v1alpha1.FloatingIP's Spec.Attribute. Older
+// galaxy releases wrote Spec.Attribute as a bare, caller-defined string; ParseAttribute accepts
+// both forms so upgrades need no data migration step.
+type Attribute struct {
+	Attr string `json:"attr,omitempty"`
+	MAC  string `json:"mac,omitempty"`
+}
+
+// ParseAttribute parses raw into an Attribute, falling back to treating it as a legacy plain
+// string attr if it is not a JSON-encoded object.
+func ParseAttribute(raw string) Attribute {
+	if raw == "" {
+		return Attribute{}
+	}
+	var attr Attribute
+	if err := json.Unmarshal([]byte(raw), &attr); err == nil {
+		return attr
+	}
+	return Attribute{Attr: raw}
+}
+
+// String marshals the Attribute back to the structured JSON form stored in Spec.Attribute, or
+// "" if a lacks both fields, so an unset attribute round-trips as the empty string instead of
+// the literal "{}".
+func (a Attribute) String() string {
+	if a.Attr == "" && a.MAC == "" {
+		return ""
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return a.Attr
+	}
+	return string(data)
 }
 
 // FloatingIPPool is FloatingIPPool structure.
 type FloatingIPPool struct {
 	RoutableSubnet *net.IPNet // the node subnet
 	nets.SparseSubnet
+	// RangeConfs carries per-range overrides (gateway, vlan, reservations), keyed by RangeID.
+	// A range missing from this map falls back to the pool-level Gateway/Vlan and has no
+	// reservations.
+	RangeConfs map[string]*RangeConf
 	sync.RWMutex
 }
 
+// RangeConf is the per-range portion of a FloatingIPPool: its own gateway, vlan and the
+// addresses inside it that are permanently excluded from allocation.
+type RangeConf struct {
+	Gateway  net.IP
+	Vlan     uint16
+	Reserved map[string]bool
+}
+
 // FloatingIPPoolConf is FloatingIP config structure.
 type FloatingIPPoolConf struct {
-	RoutableSubnet *nets.IPNet `json:"routableSubnet"` // the node subnet
-	IPs            []string    `json:"ips"`
-	Subnet         *nets.IPNet `json:"subnet"` // the vip subnet
-	Gateway        net.IP      `json:"gateway"`
-	Vlan           uint16      `json:"vlan,omitempty"`
+	RoutableSubnet *nets.IPNet   `json:"routableSubnet"` // the node subnet
+	IPs            []IPRangeConf `json:"ips"`
+	Subnet         *nets.IPNet   `json:"subnet"` // the vip subnet
+	Gateway        net.IP        `json:"gateway"`
+	Vlan           uint16        `json:"vlan,omitempty"`
+}
+
+// IPRangeConf describes one IP range entry of a pool. It may be written as a plain
+// "first-last"/CIDR string, in which case it inherits the pool-level gateway and vlan, or as an
+// object overriding the gateway, vlan and/or listing addresses reserved out of the range.
+type IPRangeConf struct {
+	IPs      string   `json:"ips"`
+	Gateway  net.IP   `json:"gateway,omitempty"`
+	Vlan     uint16   `json:"vlan,omitempty"`
+	Reserved []string `json:"reserved,omitempty"`
+}
+
+// UnmarshalJSON allows an IPRangeConf to be written as either a plain range string or a full
+// object, so existing configs using plain strings keep working unchanged.
+func (r *IPRangeConf) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		r.IPs = s
+		return nil
+	}
+	type plain IPRangeConf
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// MarshalJSON writes an IPRangeConf back as a plain string when it carries no override, keeping
+// round-tripped configs minimal.
+func (r IPRangeConf) MarshalJSON() ([]byte, error) {
+	if r.Gateway == nil && r.Vlan == 0 && len(r.Reserved) == 0 {
+		return json.Marshal(r.IPs)
+	}
+	type plain IPRangeConf
+	return json.Marshal(plain(r))
 }
 
 // MarshalJSON can marshal FloatingIPPoolConf to byte slice.
@@ -59,9 +145,22 @@ func (fip *FloatingIPPool) MarshalJSON() ([]byte, error) {
 	conf.Subnet = nets.NetsIPNet(fip.IPNet())
 	conf.Gateway = fip.Gateway
 	conf.Vlan = fip.Vlan
-	conf.IPs = make([]string, 0)
+	conf.IPs = make([]IPRangeConf, 0, len(fip.IPRanges))
 	for _, ipr := range fip.IPRanges {
-		conf.IPs = append(conf.IPs, ipr.String())
+		ipc := IPRangeConf{IPs: ipr.String()}
+		if rc := fip.RangeConfs[rangeID(ipr)]; rc != nil {
+			if !rc.Gateway.Equal(fip.Gateway) {
+				ipc.Gateway = rc.Gateway
+			}
+			if rc.Vlan != fip.Vlan {
+				ipc.Vlan = rc.Vlan
+			}
+			for addr := range rc.Reserved {
+				ipc.Reserved = append(ipc.Reserved, addr)
+			}
+			sort.Strings(ipc.Reserved)
+		}
+		conf.IPs = append(conf.IPs, ipc)
 	}
 	return json.Marshal(conf)
 }
@@ -89,27 +188,114 @@ func (fip *FloatingIPPool) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("subnet is empty")
 	}
 	fip.Vlan = conf.Vlan
-	for _, str := range conf.IPs {
-		ipr := nets.ParseIPRange(str)
-		if ipr != nil {
-			fip.IPRanges = append(fip.IPRanges, *ipr)
-		} else {
-			return fmt.Errorf("invalid ip range %s", str)
+	fip.RangeConfs = make(map[string]*RangeConf)
+	for _, ipc := range conf.IPs {
+		ipr := nets.ParseIPRange(ipc.IPs)
+		if ipr == nil {
+			return fmt.Errorf("invalid ip range %s", ipc.IPs)
+		}
+		fip.IPRanges = append(fip.IPRanges, *ipr)
+		if ipc.Gateway == nil && ipc.Vlan == 0 && len(ipc.Reserved) == 0 {
+			continue
+		}
+		rc := &RangeConf{Gateway: ipc.Gateway, Vlan: ipc.Vlan}
+		if rc.Gateway == nil {
+			rc.Gateway = fip.Gateway
+		}
+		if rc.Vlan == 0 {
+			rc.Vlan = fip.Vlan
 		}
+		if len(ipc.Reserved) > 0 {
+			rc.Reserved = make(map[string]bool, len(ipc.Reserved))
+			for _, addr := range ipc.Reserved {
+				rc.Reserved[addr] = true
+			}
+		}
+		fip.RangeConfs[rangeID(*ipr)] = rc
 	}
 	return fipCheck(fip)
 }
 
+// rangeID derives the stable identifier of a range used to key RangeConfs and to fill
+// FloatingIP.RangeID, so an allocation can be traced back to its range after a restart.
+func rangeID(ipr nets.IPRange) string {
+	return ipr.First.String()
+}
+
+// rangeConf returns the effective per-range config for the range starting at first, falling
+// back to the pool-level gateway/vlan when no override exists.
+func (fip *FloatingIPPool) rangeConf(first net.IP) *RangeConf {
+	if rc := fip.RangeConfs[first.String()]; rc != nil {
+		return rc
+	}
+	return &RangeConf{Gateway: fip.Gateway, Vlan: fip.Vlan}
+}
+
+// effectiveConf returns the effective per-range config of whichever range currently contains
+// ip, or the pool-level defaults if ip is not presently allocated from any range.
+func (fip *FloatingIPPool) effectiveConf(ip net.IP) *RangeConf {
+	for _, ipr := range fip.IPRanges {
+		if ipr.Contains(ip) {
+			return fip.rangeConf(ipr.First)
+		}
+	}
+	return &RangeConf{Gateway: fip.Gateway, Vlan: fip.Vlan}
+}
+
+// isReserved reports whether ip is permanently excluded from allocation by its range's
+// reservation list.
+func (fip *FloatingIPPool) isReserved(ip net.IP) bool {
+	for _, ipr := range fip.IPRanges {
+		if !ipr.Contains(ip) {
+			continue
+		}
+		rc := fip.RangeConfs[rangeID(ipr)]
+		return rc != nil && rc.Reserved[ip.String()]
+	}
+	return false
+}
+
+// AllocatableRangeID reports whether ip may be handed out to a new allocation and, if so, the
+// RangeID of the range it belongs to. It returns ok=false for an ip outside fip or excluded by
+// its range's reservations. AllocateIP consults this for every candidate address and stores the
+// returned RangeID on FloatingIP.RangeID, so later lookups (e.g. updateFloatingIP after a
+// restart) can find the right range again.
+func (fip *FloatingIPPool) AllocatableRangeID(ip net.IP) (id string, ok bool) {
+	for _, ipr := range fip.IPRanges {
+		if !ipr.Contains(ip) {
+			continue
+		}
+		if fip.isReserved(ip) {
+			return "", false
+		}
+		return rangeID(ipr), true
+	}
+	return "", false
+}
+
 func fipCheck(fip *FloatingIPPool) error {
-	net := net.IPNet{IP: fip.Gateway, Mask: fip.Mask}
+	defaultNet := net.IPNet{IP: fip.Gateway, Mask: fip.Mask}
 	for i := range fip.IPRanges {
-		if !net.Contains(fip.IPRanges[i].First) || !net.Contains(fip.IPRanges[i].Last) {
-			return fmt.Errorf("ip range %s not in subnet %s", fip.IPRanges[i].String(), net.String())
+		ipr := fip.IPRanges[i]
+		rc := fip.rangeConf(ipr.First)
+		rangeNet := net.IPNet{IP: rc.Gateway, Mask: fip.Mask}
+		if !rangeNet.Contains(ipr.First) || !rangeNet.Contains(ipr.Last) {
+			return fmt.Errorf("ip range %s not in subnet %s", ipr.String(), defaultNet.String())
+		}
+		for addr := range rc.Reserved {
+			ip := net.ParseIP(addr)
+			if ip == nil || !ipr.Contains(ip) {
+				return fmt.Errorf("reserved address %s not in ip range %s", addr, ipr.String())
+			}
 		}
 		if i != 0 {
-			if nets.IPToInt(fip.IPRanges[i].First) <= nets.IPToInt(fip.IPRanges[i-1].Last)+1 {
-				return fmt.Errorf("ip range %s and %s can be merge to one or has wrong order",
-					fip.IPRanges[i-1].String(), fip.IPRanges[i].String())
+			prev := fip.IPRanges[i-1]
+			if nets.IPToInt(ipr.First) <= nets.IPToInt(prev.Last)+1 {
+				prevGW, gw := fip.rangeConf(prev.First).Gateway, rc.Gateway
+				if prevGW.Equal(gw) {
+					return fmt.Errorf("ip range %s and %s can be merge to one or has wrong order",
+						prev.String(), ipr.String())
+				}
 			}
 		}
 	}
@@ -146,6 +332,10 @@ func (fip *FloatingIPPool) InsertIP(ip net.IP) bool {
 	if !fip.SparseSubnet.IPNet().Contains(ip) {
 		return false
 	}
+	if fip.isReserved(ip) {
+		// reserved addresses never re-enter the allocatable pool
+		return false
+	}
 	if len(fip.IPRanges) == 0 {
 		fip.IPRanges = append(fip.IPRanges, nets.IPtoIPRange(ip))
 		return true
@@ -185,8 +375,31 @@ func (fip *FloatingIPPool) tryMerge(i int) {
 	if i < 0 || i+1 == len(fip.IPRanges) {
 		return
 	}
-	if Minus(fip.IPRanges[i+1].First, fip.IPRanges[i].Last) == 1 {
-		fip.IPRanges[i].Last = fip.IPRanges[i+1].Last
+	cur, next := fip.IPRanges[i], fip.IPRanges[i+1]
+	if !fip.rangeConf(cur.First).Gateway.Equal(fip.rangeConf(next.First).Gateway) {
+		// ranges with differing gateways must stay distinct ranges
+		return
+	}
+	if Minus(next.First, cur.Last) == 1 {
+		nextRC := fip.RangeConfs[rangeID(next)]
+		delete(fip.RangeConfs, rangeID(next))
+		if nextRC != nil && len(nextRC.Reserved) > 0 {
+			// next's reservations must survive the merge, so fold them into the surviving
+			// range's conf instead of dropping them with next's.
+			curID := rangeID(cur)
+			curRC := fip.RangeConfs[curID]
+			if curRC == nil {
+				curRC = &RangeConf{Gateway: fip.Gateway, Vlan: fip.Vlan}
+				fip.RangeConfs[curID] = curRC
+			}
+			if curRC.Reserved == nil {
+				curRC.Reserved = make(map[string]bool, len(nextRC.Reserved))
+			}
+			for addr := range nextRC.Reserved {
+				curRC.Reserved[addr] = true
+			}
+		}
+		fip.IPRanges[i].Last = next.Last
 		if i+2 < len(fip.IPRanges) {
 			fip.IPRanges = append(fip.IPRanges[0:i+1], fip.IPRanges[i+2:]...)
 		} else {
@@ -200,6 +413,10 @@ func (fip *FloatingIPPool) RemoveIP(ip net.IP) bool {
 	if !fip.IPNet().Contains(ip) {
 		return false
 	}
+	if fip.isReserved(ip) {
+		// reserved addresses are never part of the allocatable pool
+		return false
+	}
 	if len(fip.IPRanges) == 0 {
 		return false
 	}
@@ -211,16 +428,27 @@ func (fip *FloatingIPPool) RemoveIP(ip net.IP) bool {
 			switch {
 			case ipRange.First.Equal(ipRange.Last):
 				fip.IPRanges = append(fip.IPRanges[:i], fip.IPRanges[i+1:]...)
+				delete(fip.RangeConfs, rangeID(ipRange))
 			case ipRange.First.Equal(ip):
+				oldID := rangeID(ipRange)
+				rc, hadConf := fip.RangeConfs[oldID]
+				delete(fip.RangeConfs, oldID)
 				ipRange.First = nets.IntToIP(nets.IPToInt(ipRange.First) + 1)
 				fip.IPRanges[i] = ipRange
+				if hadConf {
+					fip.RangeConfs[rangeID(ipRange)] = rc
+				}
 			case ipRange.Last.Equal(ip):
 				ipRange.Last = nets.IntToIP(nets.IPToInt(ipRange.Last) - 1)
 				fip.IPRanges[i] = ipRange
 			default:
+				rc := fip.RangeConfs[rangeID(ipRange)]
 				fip.IPRanges = append(fip.IPRanges[:i+1], append([]nets.IPRange{ipRange}, fip.IPRanges[i+1:]...)...)
 				fip.IPRanges[i].Last = nets.IntToIP(ipn - 1)
 				fip.IPRanges[i+1].First = nets.IntToIP(ipn + 1)
+				if rc != nil {
+					fip.RangeConfs[rangeID(fip.IPRanges[i+1])] = rc
+				}
 			}
 			return true
 		}
@@ -0,0 +1,48 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import "testing"
+
+// TestAttributeRoundTripEmpty verifies an Attribute with no Attr and no MAC round-trips as the
+// empty string, not the literal "{}", matching the baseline behavior for an ip with no attr set.
+func TestAttributeRoundTripEmpty(t *testing.T) {
+	empty := Attribute{}
+	if s := empty.String(); s != "" {
+		t.Errorf("expected empty Attribute to marshal to \"\", got %q", s)
+	}
+	if got := ParseAttribute(""); got != (Attribute{}) {
+		t.Errorf("expected ParseAttribute(\"\") to be empty, got %+v", got)
+	}
+	// legacy data written as the literal "{}" (e.g. by an older galaxy-ipam build) must also
+	// parse back to empty rather than being misread as a plain-string legacy attr.
+	if got := ParseAttribute("{}"); got != (Attribute{}) {
+		t.Errorf("expected ParseAttribute(\"{}\") to be empty, got %+v", got)
+	}
+}
+
+// TestAttributeRoundTrip verifies a populated Attribute survives a String/ParseAttribute round
+// trip, and that a legacy plain-string attr (pre-dating the structured JSON form) still parses.
+func TestAttributeRoundTrip(t *testing.T) {
+	attr := Attribute{Attr: "pod-xyz", MAC: "aa:bb:cc:dd:ee:ff"}
+	if got := ParseAttribute(attr.String()); got != attr {
+		t.Errorf("expected round trip to return %+v, got %+v", attr, got)
+	}
+	if got := ParseAttribute("legacy-plain-attr"); got != (Attribute{Attr: "legacy-plain-attr"}) {
+		t.Errorf("expected legacy plain attr to parse as Attr, got %+v", got)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// InspectSchemaVersion is bumped whenever PoolStatus or IPStatus gains or loses a field, so
+// clients can detect an incompatible galaxy-ipam release.
+const InspectSchemaVersion = "v1"
+
+// Inspector is the read-only status surface backing the galaxy-ipam /v1/pool and /v1/ip
+// endpoints.
+type Inspector interface {
+	InspectPool(routableSubnet string) (*PoolStatus, error)
+	InspectIP(ip net.IP) (*IPStatus, error)
+}
+
+// BoundIP is one FloatingIP CRD currently bound to a key inside a pool.
+type BoundIP struct {
+	IP        string
+	Key       string
+	Policy    uint16
+	UpdatedAt time.Time
+	Attr      string
+	MAC       string
+}
+
+// RangeStatus summarizes allocation usage of a single IPRange inside a pool.
+type RangeStatus struct {
+	RangeID   string
+	Range     string
+	Gateway   net.IP
+	Vlan      uint16
+	Total     int
+	Allocated int
+	Reserved  int
+	Free      int
+}
+
+// FragmentationStatus describes how split up the free space inside a pool is.
+type FragmentationStatus struct {
+	NumRanges        int
+	LargestFreeRange int
+}
+
+// PoolStatus is the structured result of InspectPool.
+type PoolStatus struct {
+	SchemaVersion string
+	Conf          *FloatingIPPoolConf
+	Ranges        []RangeStatus
+	Bound         []BoundIP
+	Fragmentation FragmentationStatus
+}
+
+// IPStatus is the structured result of InspectIP.
+type IPStatus struct {
+	SchemaVersion  string
+	IP             net.IP
+	RoutableSubnet string
+	RangeID        string
+	Bound          bool
+	Key            string
+	Policy         uint16
+	UpdatedAt      time.Time
+	Attr           string
+	MAC            string
+}
+
+// InspectPool returns the FloatingIPPoolConf, per-range usage counters, bound IP list and
+// fragmentation stats of the pool identified by routableSubnet.
+func (ci *crdIpam) InspectPool(routableSubnet string) (*PoolStatus, error) {
+	ci.RLock()
+	i := ci.indexOfPool(routableSubnet)
+	if i == -1 {
+		ci.RUnlock()
+		return nil, fmt.Errorf("pool %s not found", routableSubnet)
+	}
+	pool := ci.FloatingIPs[i]
+	ci.RUnlock()
+
+	fips, err := ci.listFloatingIPs()
+	if err != nil {
+		return nil, err
+	}
+	boundByIP := make(map[string]*BoundIP, len(fips.Items))
+	for i := range fips.Items {
+		fip := &fips.Items[i]
+		if fip.Spec.Key == "" {
+			continue
+		}
+		attr := ParseAttribute(fip.Spec.Attribute)
+		boundByIP[fip.Name] = &BoundIP{
+			IP:        fip.Name,
+			Key:       fip.Spec.Key,
+			Policy:    uint16(fip.Spec.Policy),
+			UpdatedAt: fip.Spec.UpdateTime.Time,
+			Attr:      attr.Attr,
+			MAC:       attr.MAC,
+		}
+	}
+
+	status := &PoolStatus{SchemaVersion: InspectSchemaVersion}
+	pool.RLock()
+	defer pool.RUnlock()
+	data, err := pool.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	conf := &FloatingIPPoolConf{}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return nil, err
+	}
+	status.Conf = conf
+
+	largestFree := 0
+	for _, ipr := range pool.IPRanges {
+		rc := pool.rangeConf(ipr.First)
+		total := int(nets.IPToInt(ipr.Last)-nets.IPToInt(ipr.First)) + 1
+		reserved := len(rc.Reserved)
+		allocated := 0
+		first, last := nets.IPToInt(ipr.First), nets.IPToInt(ipr.Last)
+		for cur := first; cur <= last; cur++ {
+			if b, ok := boundByIP[nets.IntToIP(cur).String()]; ok {
+				allocated++
+				status.Bound = append(status.Bound, *b)
+			}
+		}
+		free := total - allocated - reserved
+		if free > largestFree {
+			largestFree = free
+		}
+		status.Ranges = append(status.Ranges, RangeStatus{
+			RangeID:   rangeID(ipr),
+			Range:     ipr.String(),
+			Gateway:   rc.Gateway,
+			Vlan:      rc.Vlan,
+			Total:     total,
+			Allocated: allocated,
+			Reserved:  reserved,
+			Free:      free,
+		})
+	}
+	status.Fragmentation = FragmentationStatus{
+		NumRanges:        len(pool.IPRanges),
+		LargestFreeRange: largestFree,
+	}
+	return status, nil
+}
+
+// InspectIP returns the allocation status of a single address: which pool and range it belongs
+// to, and if bound, the key/policy/attr/updatedAt of its FloatingIP CRD.
+func (ci *crdIpam) InspectIP(ip net.IP) (*IPStatus, error) {
+	ci.RLock()
+	var pool *FloatingIPPool
+	for _, p := range ci.FloatingIPs {
+		if p.Contains(ip) {
+			pool = p
+			break
+		}
+	}
+	ci.RUnlock()
+	if pool == nil {
+		return nil, fmt.Errorf("ip %s does not belong to any floating ip pool", ip)
+	}
+	status := &IPStatus{
+		SchemaVersion:  InspectSchemaVersion,
+		IP:             ip,
+		RoutableSubnet: pool.Key(),
+	}
+	pool.RLock()
+	for _, ipr := range pool.IPRanges {
+		if ipr.Contains(ip) {
+			status.RangeID = rangeID(ipr)
+			break
+		}
+	}
+	pool.RUnlock()
+
+	fip, err := ci.getFloatingIPObject(ip.String())
+	if err != nil {
+		return status, nil
+	}
+	attr := ParseAttribute(fip.Spec.Attribute)
+	status.Bound = fip.Spec.Key != ""
+	status.Key = fip.Spec.Key
+	status.Policy = uint16(fip.Spec.Policy)
+	status.UpdatedAt = fip.Spec.UpdateTime.Time
+	status.Attr = attr.Attr
+	status.MAC = attr.MAC
+	return status, nil
+}
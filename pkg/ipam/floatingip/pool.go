@@ -0,0 +1,252 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// PoolCreateRequest is the input of crdIpam.CreatePool. Either Conf is set to create a pool
+// from an explicit definition, or PrefixLen and ParentCIDR are set to have the allocator carve
+// a free sub-prefix out of a pre-configured parent CIDR.
+type PoolCreateRequest struct {
+	// Conf, if non-nil, is used as-is and PrefixLen/ParentCIDR are ignored.
+	Conf *FloatingIPPoolConf `json:"conf,omitempty"`
+	// PrefixLen is the mask length of the sub-prefix to carve out of ParentCIDR, e.g. 26.
+	PrefixLen int `json:"prefixLen,omitempty"`
+	// ParentCIDR selects one of the pre-configured parent supernets the new pool is carved from.
+	ParentCIDR string `json:"parentCIDR,omitempty"`
+}
+
+// PoolManager is the runtime CRUD surface for FloatingIPPool objects. It backs the
+// galaxy-ipam HTTP pool endpoints so pools no longer require a process restart to take effect.
+type PoolManager interface {
+	CreatePool(req *PoolCreateRequest) (*FloatingIPPool, error)
+	UpdatePool(conf *FloatingIPPoolConf) error
+	ListPools() FloatingIPSlice
+	DeletePool(routableSubnet string, force bool) error
+}
+
+// CreatePool creates a new FloatingIPPool either from an explicit conf or by auto selecting a
+// free sub-prefix of the requested length out of one of the configured parent CIDRs. The pool is
+// persisted as a CRD and appended to the in-memory FloatingIPs slice.
+func (ci *crdIpam) CreatePool(req *PoolCreateRequest) (*FloatingIPPool, error) {
+	ci.Lock()
+	defer ci.Unlock()
+	conf := req.Conf
+	if conf == nil {
+		if req.PrefixLen == 0 || req.ParentCIDR == "" {
+			return nil, fmt.Errorf("either conf or prefixLen and parentCIDR must be set")
+		}
+		parent, err := ci.lookupParentCIDR(req.ParentCIDR)
+		if err != nil {
+			return nil, err
+		}
+		conf, err = ci.allocateSubPrefix(parent, req.PrefixLen)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pool, err := newFloatingIPPool(conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := ci.checkPoolOverlap(pool, ""); err != nil {
+		return nil, err
+	}
+	if err := fipCheck(pool); err != nil {
+		return nil, err
+	}
+	if err := ci.createFloatingIPPool(pool); err != nil {
+		return nil, err
+	}
+	ci.FloatingIPs = append(ci.FloatingIPs, pool)
+	sort.Sort(ci.FloatingIPs)
+	return pool, nil
+}
+
+// UpdatePool replaces the pool identified by conf.RoutableSubnet with a freshly parsed and
+// validated one.
+func (ci *crdIpam) UpdatePool(conf *FloatingIPPoolConf) error {
+	ci.Lock()
+	defer ci.Unlock()
+	updated, err := newFloatingIPPool(conf)
+	if err != nil {
+		return err
+	}
+	i := ci.indexOfPool(updated.Key())
+	if i == -1 {
+		return fmt.Errorf("pool %s not found", updated.Key())
+	}
+	if err := ci.checkPoolOverlap(updated, updated.Key()); err != nil {
+		return err
+	}
+	if err := fipCheck(updated); err != nil {
+		return err
+	}
+	if err := ci.updateFloatingIPPool(updated); err != nil {
+		return err
+	}
+	ci.FloatingIPs[i] = updated
+	return nil
+}
+
+// ListPools returns a snapshot of all known pools.
+func (ci *crdIpam) ListPools() FloatingIPSlice {
+	ci.RLock()
+	defer ci.RUnlock()
+	cp := make(FloatingIPSlice, len(ci.FloatingIPs))
+	copy(cp, ci.FloatingIPs)
+	return cp
+}
+
+// DeletePool removes the pool identified by routableSubnet. It fails if any FloatingIP inside
+// the pool is still bound to a key, unless force is set, in which case those FloatingIPs are
+// released as part of the cascade.
+func (ci *crdIpam) DeletePool(routableSubnet string, force bool) error {
+	ci.Lock()
+	defer ci.Unlock()
+	i := ci.indexOfPool(routableSubnet)
+	if i == -1 {
+		return fmt.Errorf("pool %s not found", routableSubnet)
+	}
+	pool := ci.FloatingIPs[i]
+	bound, err := ci.boundFloatingIPNamesInPool(pool)
+	if err != nil {
+		return err
+	}
+	if len(bound) > 0 {
+		if !force {
+			return fmt.Errorf("pool %s still has %d allocated floating ips, pass force to cascade delete", routableSubnet, len(bound))
+		}
+		for _, name := range bound {
+			if err := ci.deleteFloatingIP(name); err != nil {
+				return err
+			}
+		}
+	}
+	if err := ci.deleteFloatingIPPool(routableSubnet); err != nil {
+		return err
+	}
+	ci.FloatingIPs = append(ci.FloatingIPs[:i], ci.FloatingIPs[i+1:]...)
+	return nil
+}
+
+func (ci *crdIpam) indexOfPool(routableSubnet string) int {
+	for i, p := range ci.FloatingIPs {
+		if p.Key() == routableSubnet {
+			return i
+		}
+	}
+	return -1
+}
+
+func (ci *crdIpam) lookupParentCIDR(cidr string) (*net.IPNet, error) {
+	for _, parent := range ci.parentCIDRs {
+		if parent.String() == cidr {
+			return parent, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not a configured parent cidr", cidr)
+}
+
+// checkPoolOverlap rejects a pool whose RoutableSubnet overlaps any existing pool other than
+// the one named except (used by UpdatePool to allow updating in place).
+func (ci *crdIpam) checkPoolOverlap(pool *FloatingIPPool, except string) error {
+	for _, p := range ci.FloatingIPs {
+		if p.Key() == except {
+			continue
+		}
+		if p.RoutableSubnet.Contains(pool.RoutableSubnet.IP) || pool.RoutableSubnet.Contains(p.RoutableSubnet.IP) {
+			return fmt.Errorf("routable subnet %s overlaps with existing pool %s", pool.RoutableSubnet, p.RoutableSubnet)
+		}
+	}
+	return nil
+}
+
+// allocateSubPrefix scans the existing pools and returns the conf of the first aligned
+// sub-prefix of parent of the requested length that overlaps none of them, with a gateway set to the first
+// usable address and IPs seeded with the rest of the usable range.
+func (ci *crdIpam) allocateSubPrefix(parent *net.IPNet, prefixLen int) (*FloatingIPPoolConf, error) {
+	ones, bits := parent.Mask.Size()
+	if prefixLen <= ones || prefixLen > bits {
+		return nil, fmt.Errorf("prefix length %d is not a valid sub-prefix of %s", prefixLen, parent.String())
+	}
+	blockSize := uint32(1) << uint(bits-prefixLen)
+	numBlocks := uint32(1) << uint(prefixLen-ones)
+	parentStart := nets.IPToInt(parent.IP)
+	for i := uint32(0); i < numBlocks; i++ {
+		base := parentStart + i*blockSize
+		sub := &net.IPNet{IP: nets.IntToIP(base), Mask: net.CIDRMask(prefixLen, bits)}
+		used := false
+		for _, p := range ci.FloatingIPs {
+			if p.RoutableSubnet.Contains(sub.IP) || sub.Contains(p.RoutableSubnet.IP) {
+				used = true
+				break
+			}
+		}
+		if used {
+			continue
+		}
+		gateway := nets.IntToIP(base + 1)
+		first := nets.IntToIP(base + 2)
+		last := nets.IntToIP(base + blockSize - 2)
+		return &FloatingIPPoolConf{
+			RoutableSubnet: nets.NetsIPNet(sub),
+			Subnet:         nets.NetsIPNet(sub),
+			Gateway:        gateway,
+			IPs:            []IPRangeConf{{IPs: nets.IPRange{First: first, Last: last}.String()}},
+		}, nil
+	}
+	return nil, fmt.Errorf("no free /%d sub-prefix left in %s", prefixLen, parent.String())
+}
+
+func (ci *crdIpam) boundFloatingIPNamesInPool(pool *FloatingIPPool) ([]string, error) {
+	fips, err := ci.listFloatingIPs()
+	if err != nil {
+		return nil, err
+	}
+	var bound []string
+	for i := range fips.Items {
+		fip := &fips.Items[i]
+		if fip.Spec.Key == "" {
+			continue
+		}
+		ip := net.ParseIP(fip.Name)
+		if ip != nil && pool.Contains(ip) {
+			bound = append(bound, fip.Name)
+		}
+	}
+	return bound, nil
+}
+
+func newFloatingIPPool(conf *FloatingIPPoolConf) (*FloatingIPPool, error) {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	pool := &FloatingIPPool{}
+	if err := pool.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
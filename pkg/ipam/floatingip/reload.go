@@ -0,0 +1,143 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// ErrAllocationOrphaned is returned by ReloadConf, when PreserveOnReload is false, for every
+// bound FloatingIP that fell outside all ranges of the reloaded FloatingIPPoolConf. The caller
+// (the controller) is expected to surface it as a Kubernetes event rather than silently losing
+// track of the allocation.
+type ErrAllocationOrphaned struct {
+	IP  net.IP
+	Key string
+}
+
+func (e *ErrAllocationOrphaned) Error() string {
+	return fmt.Sprintf("floating ip %s bound to %q fell outside its pool on reload", e.IP, e.Key)
+}
+
+// ReloadConf replaces the in-memory pools with confs, diffing against outstanding bound
+// FloatingIPs. A bound ip that no longer falls inside any range is, depending on
+// ci.PreserveOnReload, either re-inserted into its original pool as a single-ip legacy range
+// pinned to its original gateway/vlan, or reported back as an ErrAllocationOrphaned.
+func (ci *crdIpam) ReloadConf(confs []*FloatingIPPoolConf) ([]*ErrAllocationOrphaned, error) {
+	ci.Lock()
+	defer ci.Unlock()
+	newPools := make(FloatingIPSlice, 0, len(confs))
+	for _, conf := range confs {
+		pool, err := newFloatingIPPool(conf)
+		if err != nil {
+			return nil, err
+		}
+		newPools = append(newPools, pool)
+	}
+
+	fips, err := ci.listFloatingIPs()
+	if err != nil {
+		return nil, err
+	}
+	var orphaned []*ErrAllocationOrphaned
+	for i := range fips.Items {
+		fip := &fips.Items[i]
+		if fip.Spec.Key == "" {
+			continue
+		}
+		ip := net.ParseIP(fip.Name)
+		if ip == nil {
+			continue
+		}
+		if poolContaining(newPools, ip) != nil {
+			continue
+		}
+		oldPool := poolContaining(ci.FloatingIPs, ip)
+		if oldPool == nil {
+			// was never managed by us, nothing to preserve
+			continue
+		}
+		if !ci.PreserveOnReload {
+			orphaned = append(orphaned, &ErrAllocationOrphaned{IP: ip, Key: fip.Spec.Key})
+			continue
+		}
+		newPools = preserveAsLegacyRange(newPools, oldPool, ip)
+	}
+	sort.Sort(newPools)
+	ci.FloatingIPs = newPools
+	return orphaned, nil
+}
+
+func poolContaining(pools FloatingIPSlice, ip net.IP) *FloatingIPPool {
+	for _, p := range pools {
+		if p.Contains(ip) {
+			return p
+		}
+	}
+	return nil
+}
+
+// preserveAsLegacyRange re-inserts ip, which used to live in oldPool, back into the pool with
+// the same RoutableSubnet in pools (creating a bare one if it was dropped entirely), pinning ip
+// to the gateway/vlan it originally had so existing routes on the node stay valid. When that
+// gateway/vlan differs from the pool's default, ip is inserted as its own standalone range
+// instead of going through InsertIP's adjacency merge, so tryMerge cannot fold it into a
+// neighbouring range before the RangeConf pinning it exists.
+func preserveAsLegacyRange(pools FloatingIPSlice, oldPool *FloatingIPPool, ip net.IP) FloatingIPSlice {
+	rc := oldPool.effectiveConf(ip)
+	for _, p := range pools {
+		if p.Key() != oldPool.Key() {
+			continue
+		}
+		if rc.Gateway.Equal(p.Gateway) && rc.Vlan == p.Vlan {
+			p.InsertIP(ip)
+		} else {
+			insertStandaloneRange(p, ip, rc)
+		}
+		return pools
+	}
+	legacy := &FloatingIPPool{
+		RoutableSubnet: oldPool.RoutableSubnet,
+		RangeConfs:     map[string]*RangeConf{rangeID(nets.IPtoIPRange(ip)): {Gateway: rc.Gateway, Vlan: rc.Vlan}},
+	}
+	legacy.Gateway = rc.Gateway
+	legacy.Vlan = rc.Vlan
+	legacy.Mask = oldPool.Mask
+	legacy.IPRanges = []nets.IPRange{nets.IPtoIPRange(ip)}
+	return append(pools, legacy)
+}
+
+// insertStandaloneRange splices ip into p as its own single-ip range pinned to rc, without
+// going through InsertIP's adjacency merge, so it cannot be silently folded into a neighbouring
+// range that has a different gateway/vlan.
+func insertStandaloneRange(p *FloatingIPPool, ip net.IP, rc *RangeConf) {
+	ipr := nets.IPtoIPRange(ip)
+	i := sort.Search(len(p.IPRanges), func(i int) bool {
+		return nets.IPToInt(p.IPRanges[i].First) > nets.IPToInt(ip)
+	})
+	p.IPRanges = append(p.IPRanges, nets.IPRange{})
+	copy(p.IPRanges[i+1:], p.IPRanges[i:])
+	p.IPRanges[i] = ipr
+	if p.RangeConfs == nil {
+		p.RangeConfs = make(map[string]*RangeConf)
+	}
+	p.RangeConfs[rangeID(ipr)] = &RangeConf{Gateway: rc.Gateway, Vlan: rc.Vlan}
+}
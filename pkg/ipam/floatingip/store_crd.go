@@ -71,6 +71,10 @@ func (ci *crdIpam) getFloatingIP(name string) error {
 	return err
 }
 
+func (ci *crdIpam) getFloatingIPObject(name string) (*v1alpha1.FloatingIP, error) {
+	return ci.client.GalaxyV1alpha1().FloatingIPs().Get(name, metav1.GetOptions{})
+}
+
 func (ci *crdIpam) updateFloatingIP(toUpdate *FloatingIP) error {
 	glog.V(4).Infof("update floatingIP %v", *toUpdate)
 	fip, err := ci.client.GalaxyV1alpha1().FloatingIPs().Get(toUpdate.IP.String(), metav1.GetOptions{})
@@ -82,10 +86,58 @@ func (ci *crdIpam) updateFloatingIP(toUpdate *FloatingIP) error {
 	return err
 }
 
+func (ci *crdIpam) listFloatingIPPools() (*v1alpha1.FloatingIPPoolList, error) {
+	return ci.client.GalaxyV1alpha1().FloatingIPPools().List(metav1.ListOptions{})
+}
+
+func (ci *crdIpam) createFloatingIPPool(pool *FloatingIPPool) error {
+	glog.V(4).Infof("create floatingIPPool %s", pool.Key())
+	data, err := pool.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	crd := &v1alpha1.FloatingIPPool{
+		TypeMeta:   metav1.TypeMeta{Kind: constant.ResourceKindFloatingIPPool, APIVersion: constant.ApiVersion},
+		ObjectMeta: metav1.ObjectMeta{Name: poolCRDName(pool.Key())},
+		Spec:       v1alpha1.FloatingIPPoolSpec{JSON: string(data)},
+	}
+	_, err = ci.client.GalaxyV1alpha1().FloatingIPPools().Create(crd)
+	return err
+}
+
+func (ci *crdIpam) updateFloatingIPPool(pool *FloatingIPPool) error {
+	glog.V(4).Infof("update floatingIPPool %s", pool.Key())
+	name := poolCRDName(pool.Key())
+	crd, err := ci.client.GalaxyV1alpha1().FloatingIPPools().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	data, err := pool.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	crd.Spec.JSON = string(data)
+	_, err = ci.client.GalaxyV1alpha1().FloatingIPPools().Update(crd)
+	return err
+}
+
+func (ci *crdIpam) deleteFloatingIPPool(routableSubnet string) error {
+	glog.V(4).Infof("delete floatingIPPool %s", routableSubnet)
+	return ci.client.GalaxyV1alpha1().FloatingIPPools().Delete(poolCRDName(routableSubnet), &metav1.DeleteOptions{})
+}
+
+// poolCRDName sanitizes a routable subnet CIDR (e.g. "10.0.0.0/24") into a valid CRD object name.
+func poolCRDName(routableSubnet string) string {
+	return strings.NewReplacer("/", "-", ":", "-").Replace(routableSubnet)
+}
+
+// assign writes f onto spec. Spec.Attribute is always (re-)written in the structured Attribute
+// form, which upgrades any legacy plain-string payload the first time a FloatingIP is updated.
 func assign(spec *v1alpha1.FloatingIP, f *FloatingIP) {
 	spec.Spec.Key = f.Key
 	spec.Spec.Policy = constant.ReleasePolicy(f.Policy)
-	spec.Spec.Attribute = f.Attr
+	spec.Spec.Attribute = Attribute{Attr: f.Attr, MAC: f.MAC}.String()
 	spec.Spec.Subnet = strings.Join(f.Subnets.List(), ",")
 	spec.Spec.UpdateTime = metav1.NewTime(f.UpdatedAt)
+	spec.Spec.RangeID = f.RangeID
 }